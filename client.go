@@ -1,13 +1,19 @@
 package redistore
 
 import (
-	"github.com/go-redis/redis/v7"
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
 )
 
 type Client interface {
-	Ping() *redis.StatusCmd
-	Get(key string) *redis.StringCmd
-	Do(args ...interface{}) *redis.Cmd
-	Del(keys ...string) *redis.IntCmd
-	Scan(cursor uint64, match string, count int64) *redis.ScanCmd
+	Ping(ctx context.Context) *redis.StatusCmd
+	Get(ctx context.Context, key string) *redis.StringCmd
+	MGet(ctx context.Context, keys ...string) *redis.SliceCmd
+	Do(ctx context.Context, args ...interface{}) *redis.Cmd
+	Del(ctx context.Context, keys ...string) *redis.IntCmd
+	Expire(ctx context.Context, key string, expiration time.Duration) *redis.BoolCmd
+	TTL(ctx context.Context, key string) *redis.DurationCmd
+	Scan(ctx context.Context, cursor uint64, match string, count int64) *redis.ScanCmd
 }
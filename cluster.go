@@ -0,0 +1,166 @@
+package redistore
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// mgetBatchSize caps how many keys are sent to a single MGET call.
+const mgetBatchSize = 500
+
+// clusterClient returns the underlying *redis.ClusterClient when s.client
+// is talking to a Redis Cluster, and false otherwise.
+func (s *RediStore) clusterClient() (*redis.ClusterClient, bool) {
+	cc, ok := s.client.(*redis.ClusterClient)
+	return cc, ok
+}
+
+// scanKeys scans every key matching the store's prefix, invoking fn with
+// each page of keys. On a Redis Cluster the scan is fanned out across
+// every master so keys living on any shard are found; ForEachMaster runs
+// one goroutine per master, so fn is serialized behind a mutex to keep it
+// single-threaded regardless of topology -- callers of IterateAll/GetAll
+// never have to worry about fn being invoked concurrently.
+func (s *RediStore) scanKeys(ctx context.Context, fn func(keys []string) error) error {
+	match := s.keyPrefix + "*"
+	if cc, ok := s.clusterClient(); ok {
+		var mu sync.Mutex
+		return cc.ForEachMaster(ctx, func(ctx context.Context, master *redis.Client) error {
+			return scanNode(ctx, master, match, func(keys []string) error {
+				mu.Lock()
+				defer mu.Unlock()
+				return fn(keys)
+			})
+		})
+	}
+	return scanNode(ctx, s.client, match, fn)
+}
+
+// scanNode drives a single SCAN cursor to completion against one node.
+func scanNode(ctx context.Context, client redis.Cmdable, match string, fn func(keys []string) error) error {
+	var cursor uint64
+	for {
+		keys, next, err := client.Scan(ctx, cursor, match, 0).Result()
+		if err != nil {
+			return err
+		}
+		if len(keys) > 0 {
+			if err := fn(keys); err != nil {
+				return err
+			}
+		}
+		cursor = next
+		if cursor == 0 {
+			return nil
+		}
+	}
+}
+
+// mget fetches the values for keys using MGET in batches of mgetBatchSize,
+// falling back to per-key GET on a Redis Cluster when a batch's keys don't
+// all hash to the same slot.
+func (s *RediStore) mget(ctx context.Context, keys []string) ([]interface{}, error) {
+	_, isCluster := s.clusterClient()
+	values := make([]interface{}, 0, len(keys))
+	for start := 0; start < len(keys); start += mgetBatchSize {
+		end := start + mgetBatchSize
+		if end > len(keys) {
+			end = len(keys)
+		}
+		batch := keys[start:end]
+		if isCluster && !sameSlot(batch) {
+			for _, key := range batch {
+				val, err := s.client.Get(ctx, key).Result()
+				if err != nil && err != redis.Nil {
+					return nil, err
+				}
+				if err == redis.Nil {
+					values = append(values, nil)
+					continue
+				}
+				values = append(values, val)
+			}
+			continue
+		}
+		res, err := s.client.MGet(ctx, batch...).Result()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, res...)
+	}
+	return values, nil
+}
+
+// sameSlot reports whether every key hashes to the same Redis Cluster slot.
+func sameSlot(keys []string) bool {
+	if len(keys) < 2 {
+		return true
+	}
+	slot := clusterSlot(keys[0])
+	for _, key := range keys[1:] {
+		if clusterSlot(key) != slot {
+			return false
+		}
+	}
+	return true
+}
+
+// groupBySlot buckets keys by their Redis Cluster hash slot.
+func groupBySlot(keys []string) map[uint16][]string {
+	groups := make(map[uint16][]string)
+	for _, key := range keys {
+		slot := clusterSlot(key)
+		groups[slot] = append(groups[slot], key)
+	}
+	return groups
+}
+
+// HashTag wraps key in a Redis Cluster hash tag so that it and any other key
+// sharing the same tag always hash to the same slot, letting multi-key
+// operations on them be atomic, e.g. HashTag("user:123", "session:abc")
+// returns "{user:123}:session:abc".
+func HashTag(tag, key string) string {
+	return "{" + tag + "}:" + key
+}
+
+// clusterSlot returns the Redis Cluster hash slot for key, honouring
+// "{hash tag}" substrings per the Redis Cluster spec.
+func clusterSlot(key string) uint16 {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			key = key[start+1 : start+1+end]
+		}
+	}
+	return crc16(key) % 16384
+}
+
+// crc16Table is generated once at init and matches the CRC16/CCITT table
+// Redis Cluster uses to compute hash slots.
+var crc16Table = func() [256]uint16 {
+	const poly = 0x1021
+	var tab [256]uint16
+	for i := 0; i < 256; i++ {
+		crc := uint16(i) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ poly
+			} else {
+				crc <<= 1
+			}
+		}
+		tab[i] = crc
+	}
+	return tab
+}()
+
+// crc16 computes the CRC16/CCITT checksum Redis Cluster uses for key hashing.
+func crc16(s string) uint16 {
+	var crc uint16
+	for i := 0; i < len(s); i++ {
+		crc = crc<<8 ^ crc16Table[byte(crc>>8)^s[i]]
+	}
+	return crc
+}
@@ -0,0 +1,33 @@
+package redistore
+
+import (
+	"github.com/redis/go-redis/v9"
+)
+
+// NewRedisClusterStore returns a new RediStore backed by a Redis Cluster. It
+// wires up a *redis.ClusterClient with route-by-latency reads enabled; since
+// RediStore detects the underlying *redis.ClusterClient at runtime, GetAll,
+// IterateAll and DeleteByID automatically fan out across shards instead of
+// quietly misbehaving the way a single-node SCAN/DEL would.
+func NewRedisClusterStore(addrs []string, keyPrefix string, keyPairs ...[]byte) (*RediStore, error) {
+	client := redis.NewClusterClient(&redis.ClusterOptions{
+		Addrs:          addrs,
+		RouteByLatency: true,
+	})
+	return NewRedisStore(client, keyPrefix, keyPairs...)
+}
+
+// NewRedisSentinelStore returns a new RediStore backed by a Redis Sentinel
+// deployment. It wires up a failover-aware *redis.Client via
+// redis.NewFailoverClient, reading from the master only: replicas aren't
+// used for live session reads since they may still be catching up with a
+// just-written session.
+func NewRedisSentinelStore(masterName string, sentinelAddrs []string, password, keyPrefix string, keyPairs ...[]byte) (*RediStore, error) {
+	client := redis.NewFailoverClient(&redis.FailoverOptions{
+		MasterName:    masterName,
+		SentinelAddrs: sentinelAddrs,
+		Password:      password,
+		ReplicaOnly:   false,
+	})
+	return NewRedisStore(client, keyPrefix, keyPairs...)
+}
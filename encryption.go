@@ -0,0 +1,85 @@
+package redistore
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"io"
+	"strings"
+)
+
+// ticketSecretSize is the length, in bytes, of a per-session ticket secret.
+const ticketSecretSize = 32
+
+// generateTicketSecret returns a fresh random secret for encrypting one
+// session in ticket mode.
+func generateTicketSecret() ([]byte, error) {
+	secret := make([]byte, ticketSecretSize)
+	if _, err := io.ReadFull(rand.Reader, secret); err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
+
+// encryptTicket encrypts plaintext with AES-GCM using secret as the key,
+// prepending the nonce to the returned ciphertext.
+func encryptTicket(secret, plaintext []byte) ([]byte, error) {
+	gcm, err := ticketGCM(secret)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// decryptTicket reverses encryptTicket.
+func decryptTicket(secret, ciphertext []byte) ([]byte, error) {
+	gcm, err := ticketGCM(secret)
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) < gcm.NonceSize() {
+		return nil, errors.New("redistore: ticket ciphertext is too short")
+	}
+	nonce, data := ciphertext[:gcm.NonceSize()], ciphertext[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, data, nil)
+}
+
+func ticketGCM(secret []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(secret)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encodeTicketCookie packs a session ID and its per-session secret into the
+// value that gets signed and placed in the session cookie. The ID is
+// base64-encoded alongside the secret, not carried raw, so a KeyGenFunc that
+// happens to produce an ID containing "|" can't be confused with the
+// delimiter.
+func encodeTicketCookie(id string, secret []byte) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(id)) + "|" + base64.RawURLEncoding.EncodeToString(secret)
+}
+
+// decodeTicketCookie reverses encodeTicketCookie.
+func decodeTicketCookie(value string) (id string, secret []byte, err error) {
+	encodedID, encodedSecret, found := strings.Cut(value, "|")
+	if !found {
+		return "", nil, errors.New("redistore: malformed ticket cookie value")
+	}
+	idBytes, err := base64.RawURLEncoding.DecodeString(encodedID)
+	if err != nil {
+		return "", nil, err
+	}
+	secret, err = base64.RawURLEncoding.DecodeString(encodedSecret)
+	if err != nil {
+		return "", nil, err
+	}
+	return string(idBytes), secret, nil
+}
@@ -5,25 +5,44 @@
 package redistore
 
 import (
+	"bytes"
+	"context"
 	"encoding/base32"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
-	"github.com/go-redis/redis/v7"
+	"github.com/redis/go-redis/v9"
 
 	"github.com/gorilla/securecookie"
 	"github.com/gorilla/sessions"
 )
 
+// KeyGenFunc generates a new session ID. The default implementation returns
+// the base32 encoding of 32 securecookie-generated random bytes. Any string
+// is a valid session ID; the ticket cookie encoding used when encryption is
+// enabled doesn't require it to avoid any particular character.
+type KeyGenFunc func() (string, error)
+
+// defaultKeyGen is the KeyGenFunc used by NewRedisStore.
+func defaultKeyGen() (string, error) {
+	return strings.TrimRight(base32.StdEncoding.EncodeToString(securecookie.GenerateRandomKey(32)), "="), nil
+}
+
 type RediStore struct {
 	client     redis.UniversalClient
 	codecs     []securecookie.Codec
 	options    *sessions.Options
 	serializer SessionSerializer
+	keyGen     KeyGenFunc
 	maxLength  int
 	keyPrefix  string
+	encryption bool
+
+	slidingExpiration bool
 }
 
 // NewRedisStore returns a new RedisStore.
@@ -36,10 +55,11 @@ func NewRedisStore(client redis.UniversalClient, keyPrefix string, keyPairs ...[
 			MaxAge: 4096,
 		},
 		serializer: JSONSerializer{},
+		keyGen:     defaultKeyGen,
 		maxLength:  4096,
 		keyPrefix:  keyPrefix,
 	}
-	_, err := store.ping()
+	_, err := store.ping(context.Background())
 	return store, err
 }
 
@@ -72,6 +92,32 @@ func (s *RediStore) SetSerializer(serializer SessionSerializer) *RediStore {
 	return s
 }
 
+// SetKeyGen sets the function used to generate new session IDs.
+func (s *RediStore) SetKeyGen(keyGen KeyGenFunc) *RediStore {
+	s.keyGen = keyGen
+	return s
+}
+
+// SetEncryption toggles per-session ticket encryption. When enabled, Save
+// generates a fresh per-session secret, encrypts the serialized session with
+// AES-GCM, and carries the secret only in the signed session cookie as
+// "base64(ID)|base64(secret)" -- the secret is rotated on every Save and never
+// stored in redis, so a stolen Redis snapshot is useless without also
+// capturing the user's live cookie.
+func (s *RediStore) SetEncryption(enabled bool) *RediStore {
+	s.encryption = enabled
+	return s
+}
+
+// SetSlidingExpiration toggles sliding expiration. When enabled, load issues
+// EXPIRE keyPrefix+ID after every successful read, pushing a session's TTL
+// forward on each request instead of expiring it at a fixed wall-clock
+// moment regardless of activity.
+func (s *RediStore) SetSlidingExpiration(enabled bool) *RediStore {
+	s.slidingExpiration = enabled
+	return s
+}
+
 // Client returns the Client.
 func (s *RediStore) Client() redis.UniversalClient {
 	return s.client
@@ -103,6 +149,12 @@ func (s *RediStore) Get(r *http.Request, name string) (*sessions.Session, error)
 //
 // See gorilla/sessions FilesystemStore.New().
 func (s *RediStore) New(r *http.Request, name string) (*sessions.Session, error) {
+	return s.NewCtx(r.Context(), r, name)
+}
+
+// NewCtx is like New but lets the caller supply the context used for the
+// Redis round trip instead of inheriting it from r.
+func (s *RediStore) NewCtx(ctx context.Context, r *http.Request, name string) (*sessions.Session, error) {
 	var (
 		err error
 		ok  bool
@@ -113,10 +165,19 @@ func (s *RediStore) New(r *http.Request, name string) (*sessions.Session, error)
 	session.Options = &options
 	session.IsNew = true
 	if c, errCookie := r.Cookie(name); errCookie == nil {
-		err = securecookie.DecodeMulti(name, c.Value, &session.ID, s.codecs...)
+		var cookieValue string
+		err = securecookie.DecodeMulti(name, c.Value, &cookieValue, s.codecs...)
 		if err == nil {
-			ok, err = s.load(session)
-			session.IsNew = !(err == nil && ok) // not new if no error and data available
+			var secret []byte
+			if s.encryption {
+				session.ID, secret, err = decodeTicketCookie(cookieValue)
+			} else {
+				session.ID = cookieValue
+			}
+			if err == nil {
+				ok, err = s.load(ctx, session, secret)
+				session.IsNew = !(err == nil && ok) // not new if no error and data available
+			}
 		}
 	}
 	return session, err
@@ -124,32 +185,58 @@ func (s *RediStore) New(r *http.Request, name string) (*sessions.Session, error)
 
 // Save adds a single session to the response.
 func (s *RediStore) Save(r *http.Request, w http.ResponseWriter, session *sessions.Session) error {
+	return s.SaveCtx(r.Context(), r, w, session)
+}
+
+// SaveCtx is like Save but lets the caller supply the context used for the
+// Redis round trip instead of inheriting it from r.
+func (s *RediStore) SaveCtx(ctx context.Context, r *http.Request, w http.ResponseWriter, session *sessions.Session) error {
 	// Marked for deletion.
 	if session.Options.MaxAge <= 0 {
-		if err := s.client.Do("DEL", s.keyPrefix+session.ID).Err(); err != nil {
+		if err := s.client.Del(ctx, s.keyPrefix+session.ID).Err(); err != nil {
 			return err
 		}
 		http.SetCookie(w, sessions.NewCookie(session.Name(), "", session.Options))
-	} else {
-		// Build an alphanumeric key for the redis store.
-		if session.ID == "" {
-			session.ID = strings.TrimRight(base32.StdEncoding.EncodeToString(securecookie.GenerateRandomKey(32)), "=")
+		return nil
+	}
+	// Generate a new session ID with the store's KeyGenFunc.
+	if session.ID == "" {
+		id, err := s.keyGen()
+		if err != nil {
+			return fmt.Errorf("redistore: failed to generate session id: %w", err)
 		}
-		if err := s.save(session); err != nil {
+		session.ID = id
+	}
+	cookieValue := session.ID
+	if s.encryption {
+		secret, err := generateTicketSecret()
+		if err != nil {
 			return err
 		}
-		encoded, err := securecookie.EncodeMulti(session.Name(), session.ID, s.codecs...)
-		if err != nil {
+		if err := s.saveEncrypted(ctx, session, secret); err != nil {
 			return err
 		}
-		http.SetCookie(w, sessions.NewCookie(session.Name(), encoded, session.Options))
+		cookieValue = encodeTicketCookie(session.ID, secret)
+	} else if err := s.save(ctx, session); err != nil {
+		return err
+	}
+	encoded, err := securecookie.EncodeMulti(session.Name(), cookieValue, s.codecs...)
+	if err != nil {
+		return err
 	}
+	http.SetCookie(w, sessions.NewCookie(session.Name(), encoded, session.Options))
 	return nil
 }
 
 // Delete removes the session from redis, and sets the cookie to expire.
 func (s *RediStore) Delete(r *http.Request, w http.ResponseWriter, session *sessions.Session) error {
-	if err := s.client.Del(s.keyPrefix + session.ID).Err(); err != nil {
+	return s.DeleteCtx(r.Context(), r, w, session)
+}
+
+// DeleteCtx is like Delete but lets the caller supply the context used for
+// the Redis round trip instead of inheriting it from r.
+func (s *RediStore) DeleteCtx(ctx context.Context, r *http.Request, w http.ResponseWriter, session *sessions.Session) error {
+	if err := s.client.Del(ctx, s.keyPrefix+session.ID).Err(); err != nil {
 		return err
 	}
 	// Set cookie to expire.
@@ -165,15 +252,30 @@ func (s *RediStore) Delete(r *http.Request, w http.ResponseWriter, session *sess
 
 // Update updates the session in redis.
 func (s *RediStore) Update(session *sessions.Session) error {
+	return s.UpdateCtx(context.Background(), session)
+}
+
+// UpdateCtx is like Update but lets the caller supply a context for the
+// Redis round trip.
+//
+// When encryption is enabled UpdateCtx returns an error instead of saving:
+// the per-session secret is rotated on every Save and only ever carried in
+// the session cookie, which Update has no access to. Use Save to persist
+// changes to an encrypted session instead. Deleting a session by setting
+// its MaxAge to 0 or less still works with encryption enabled.
+func (s *RediStore) UpdateCtx(ctx context.Context, session *sessions.Session) error {
 	if session.Options.MaxAge <= 0 {
-		if err := s.client.Do("DEL", s.keyPrefix+session.ID).Err(); err != nil {
+		if err := s.client.Del(ctx, s.keyPrefix+session.ID).Err(); err != nil {
 			return err
 		}
 	} else {
 		if session.ID == "" {
 			return fmt.Errorf("redistore: invalid session id")
 		}
-		if err := s.save(session); err != nil {
+		if s.encryption {
+			return errors.New("redistore: Update is not supported when encryption is enabled, use Save instead")
+		}
+		if err := s.save(ctx, session); err != nil {
 			return err
 		}
 	}
@@ -182,7 +284,13 @@ func (s *RediStore) Update(session *sessions.Session) error {
 
 // DeleteByID deletes sessions from redis by id.
 func (s *RediStore) DeleteByID(ids ...string) error {
-	formattedIds := []string{}
+	return s.DeleteByIDCtx(context.Background(), ids...)
+}
+
+// DeleteByIDCtx is like DeleteByID but lets the caller supply a context for
+// the Redis round trip.
+func (s *RediStore) DeleteByIDCtx(ctx context.Context, ids ...string) error {
+	formattedIds := make([]string, 0, len(ids))
 	for _, id := range ids {
 		if !strings.Contains(id, s.keyPrefix) {
 			formattedIds = append(formattedIds, s.keyPrefix+id)
@@ -190,63 +298,216 @@ func (s *RediStore) DeleteByID(ids ...string) error {
 			formattedIds = append(formattedIds, id)
 		}
 	}
-	return s.client.Del(formattedIds...).Err()
+	if _, ok := s.clusterClient(); !ok {
+		return s.client.Del(ctx, formattedIds...).Err()
+	}
+	// Keys may live on different shards, so DEL has to be issued per slot.
+	for _, keys := range groupBySlot(formattedIds) {
+		if err := s.client.Del(ctx, keys...).Err(); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // GetAll returns all sessions stored in redis.
 func (s *RediStore) GetAll() ([]*sessions.Session, error) {
-	keys, _, err := s.client.Scan(0, s.keyPrefix+"*", 0).Result()
-	if err != nil {
-		return nil, err
-	}
+	return s.GetAllCtx(context.Background())
+}
+
+// GetAllCtx is like GetAll but lets the caller supply a context for the
+// Redis round trips.
+func (s *RediStore) GetAllCtx(ctx context.Context) ([]*sessions.Session, error) {
 	results := []*sessions.Session{}
-	for _, key := range keys {
-		val, err := s.client.Get(key).Result()
+	err := s.IterateAllCtx(ctx, func(sess *sessions.Session) error {
+		results = append(results, sess)
+		return nil
+	})
+	return results, err
+}
+
+// IterateAll walks every session in the store, invoking fn for each one.
+// Unlike GetAll it never materializes the full result set in memory, and on
+// a Redis Cluster it fans the scan out across every master so sessions
+// aren't silently dropped once the keyspace outgrows a single SCAN page.
+// fn is never called concurrently, even when the scan is fanned out across
+// a cluster's masters, so it's safe for fn to mutate state it closes over
+// without its own synchronization.
+func (s *RediStore) IterateAll(fn func(*sessions.Session) error) error {
+	return s.IterateAllCtx(context.Background(), fn)
+}
+
+// IterateAllCtx is like IterateAll but lets the caller supply a context for
+// the Redis round trips.
+//
+// IterateAllCtx cannot be used when encryption is enabled: each session's
+// secret lives only in that user's cookie, never in redis, so there's no
+// way to decrypt the stored ciphertext in bulk.
+func (s *RediStore) IterateAllCtx(ctx context.Context, fn func(*sessions.Session) error) error {
+	if s.encryption {
+		return errors.New("redistore: IterateAll/GetAll are not supported when encryption is enabled")
+	}
+	return s.scanKeys(ctx, func(keys []string) error {
+		values, err := s.mget(ctx, keys)
 		if err != nil {
-			return nil, err
+			return err
 		}
-		sess := &sessions.Session{
-			ID:      strings.Replace(key, s.keyPrefix, "", -1),
-			Values:  make(map[interface{}]interface{}),
-			Options: s.options,
+		for i, key := range keys {
+			data, ok := values[i].(string)
+			if !ok {
+				continue // key expired between SCAN and MGET
+			}
+			maxAge, payload, hasMaxAge := decodeMaxAgeEnvelope([]byte(data))
+			options := *s.options
+			if hasMaxAge {
+				options.MaxAge = maxAge
+			}
+			sess := &sessions.Session{
+				ID:      strings.Replace(key, s.keyPrefix, "", -1),
+				Values:  make(map[interface{}]interface{}),
+				Options: &options,
+			}
+			if err := s.serializer.Deserialize(payload, sess); err != nil {
+				return err
+			}
+			if err := fn(sess); err != nil {
+				return err
+			}
 		}
-		err = s.serializer.Deserialize([]byte(val), sess)
-		results = append(results, sess)
-	}
-	return results, nil
+		return nil
+	})
 }
 
 // ping does an internal ping against a server to check if it is alive.
-func (s *RediStore) ping() (bool, error) {
-	data, err := s.client.Ping().Result()
+func (s *RediStore) ping(ctx context.Context) (bool, error) {
+	data, err := s.client.Ping(ctx).Result()
 	if err != nil {
 		return false, err
 	}
 	return (data == "PONG"), nil
 }
 
-// load reads the session from redis.
+// load reads the session from redis. secret is only used when encryption is
+// enabled, to decrypt the ticket read back from redis.
 // returns true if there is a sessoin data in DB
-func (s *RediStore) load(session *sessions.Session) (bool, error) {
-	data, err := s.client.Get(s.keyPrefix + session.ID).Result()
+func (s *RediStore) load(ctx context.Context, session *sessions.Session, secret []byte) (bool, error) {
+	data, err := s.client.Get(ctx, s.keyPrefix+session.ID).Result()
 	if err != nil && err != redis.Nil {
 		return false, err
 	}
 	if err == redis.Nil {
 		return false, nil // no data was associated with this key
 	}
-	return true, s.serializer.Deserialize([]byte(data), session)
+	maxAge, payload, ok := decodeMaxAgeEnvelope([]byte(data))
+	if !ok {
+		// A value written before chunk0-5's envelope existed, or by an old
+		// binary still running during a rolling deploy. There's no saved
+		// MaxAge to recover, so fall back to whatever TTL redis already has
+		// on the key rather than misparsing 4 bytes off the real payload.
+		ttl, err := s.client.TTL(ctx, s.keyPrefix+session.ID).Result()
+		if err != nil {
+			return false, err
+		}
+		maxAge = int(ttl.Seconds())
+	}
+	// Restore the MaxAge that was actually in effect when this entry was
+	// saved -- NewCtx seeds session.Options from the store's defaults before
+	// load runs, so without this a "remember me" session with a long
+	// per-session MaxAge would have its sliding expiration collapse to the
+	// store default on every read.
+	session.Options.MaxAge = maxAge
+	if s.encryption {
+		payload, err = decryptTicket(secret, payload)
+		if err != nil {
+			return false, err
+		}
+	}
+	if err := s.serializer.Deserialize(payload, session); err != nil {
+		return false, err
+	}
+	if s.slidingExpiration {
+		if err := s.expire(ctx, session.ID, session.Options.MaxAge); err != nil {
+			return true, err
+		}
+	}
+	return true, nil
+}
+
+// Touch refreshes a session's TTL in redis without altering its stored
+// value, respecting a per-session Options.MaxAge override the same way Save
+// does. Useful for websocket/long-poll keepalives that only need to keep a
+// session alive.
+func (s *RediStore) Touch(ctx context.Context, session *sessions.Session) error {
+	if session.ID == "" {
+		return fmt.Errorf("redistore: invalid session id")
+	}
+	return s.expire(ctx, session.ID, session.Options.MaxAge)
+}
+
+// expire sets keyPrefix+id's TTL to maxAge seconds.
+func (s *RediStore) expire(ctx context.Context, id string, maxAge int) error {
+	return s.client.Expire(ctx, s.keyPrefix+id, time.Duration(maxAge)*time.Second).Err()
 }
 
 // save stores the session in redis.
-func (s *RediStore) save(session *sessions.Session) error {
+func (s *RediStore) save(ctx context.Context, session *sessions.Session) error {
 	b, err := s.serializer.Serialize(session)
 	if err != nil {
 		return err
 	}
-	if s.maxLength != 0 && len(b) > s.maxLength {
+	return s.store(ctx, session.ID, session.Options.MaxAge, b)
+}
+
+// saveEncrypted serializes session, encrypts it with secret, and stores the
+// ciphertext in redis. The secret never touches redis -- it only ever
+// travels inside the signed session cookie.
+func (s *RediStore) saveEncrypted(ctx context.Context, session *sessions.Session, secret []byte) error {
+	b, err := s.serializer.Serialize(session)
+	if err != nil {
+		return err
+	}
+	ciphertext, err := encryptTicket(secret, b)
+	if err != nil {
+		return err
+	}
+	return s.store(ctx, session.ID, session.Options.MaxAge, ciphertext)
+}
+
+// store writes payload to keyPrefix+id with a TTL of maxAge seconds,
+// enforcing maxLength first. maxAge is also prepended to the stored value
+// so a later load/IterateAll can recover the per-session MaxAge that was in
+// effect at save time.
+func (s *RediStore) store(ctx context.Context, id string, maxAge int, payload []byte) error {
+	if s.maxLength != 0 && len(payload) > s.maxLength {
 		return errors.New("redistore: the value to RediStore is too big")
 	}
-	age := session.Options.MaxAge
-	return s.client.Do("SETEX", s.keyPrefix+session.ID, age, b).Err()
+	return s.client.Do(ctx, "SETEX", s.keyPrefix+id, maxAge, encodeMaxAgeEnvelope(maxAge, payload)).Err()
+}
+
+// maxAgeEnvelopeMagic tags a value as carrying a MaxAge envelope, so a value
+// written by a pre-chunk0-5 binary (or one still running during a rolling
+// deploy) can be told apart from one written by this code, instead of
+// corrupting its payload by blindly stripping 4 bytes off the front.
+var maxAgeEnvelopeMagic = []byte("RSV1")
+
+// encodeMaxAgeEnvelope prepends maxAgeEnvelopeMagic and maxAge, as a
+// big-endian uint32, to payload.
+func encodeMaxAgeEnvelope(maxAge int, payload []byte) []byte {
+	buf := make([]byte, len(maxAgeEnvelopeMagic)+4+len(payload))
+	n := copy(buf, maxAgeEnvelopeMagic)
+	binary.BigEndian.PutUint32(buf[n:], uint32(maxAge))
+	copy(buf[n+4:], payload)
+	return buf
+}
+
+// decodeMaxAgeEnvelope reverses encodeMaxAgeEnvelope. ok reports whether data
+// actually carried the envelope; when it doesn't, data is returned unchanged
+// as payload and the caller must fall back to some other way of recovering
+// MaxAge (load derives it from the key's live TTL).
+func decodeMaxAgeEnvelope(data []byte) (maxAge int, payload []byte, ok bool) {
+	if len(data) < len(maxAgeEnvelopeMagic)+4 || !bytes.Equal(data[:len(maxAgeEnvelopeMagic)], maxAgeEnvelopeMagic) {
+		return 0, data, false
+	}
+	rest := data[len(maxAgeEnvelopeMagic):]
+	return int(binary.BigEndian.Uint32(rest[:4])), rest[4:], true
 }
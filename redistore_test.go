@@ -2,14 +2,18 @@ package redistore
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
+	"encoding/gob"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
+	"time"
 
-	"github.com/go-redis/redis/v7"
+	"github.com/redis/go-redis/v9"
 
 	"github.com/gorilla/sessions"
 )
@@ -101,6 +105,10 @@ type FlashMessage struct {
 	Message string
 }
 
+func init() {
+	gob.Register(&FlashMessage{})
+}
+
 func TestRedisStore(t *testing.T) {
 	var (
 		req     *http.Request
@@ -313,3 +321,308 @@ func TestRedisStore(t *testing.T) {
 		}
 	}
 }
+
+// TestSlidingExpirationAndTouch requires a live Redis (see setup()). It
+// guards the "remember me" scenario the chunk0-5 request was about: a
+// session saved with a long per-session MaxAge must keep that MaxAge, not
+// the store default, across a sliding-expiration reload, and Touch must
+// succeed on the reloaded session.
+func TestSlidingExpirationAndTouch(t *testing.T) {
+	conn := newConnection(setup())
+	defer conn.Close()
+	store, err := NewRedisStore(conn, "session_sliding_", []byte("secret-key"))
+	if err != nil {
+		t.Fatalf("Error getting store: %s", err)
+	}
+	store.SetSlidingExpiration(true)
+
+	const rememberMeMaxAge = 30 * 24 * 3600 // 30 days
+
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	rsp := NewRecorder()
+	session, err := store.New(req, "session-key")
+	if err != nil {
+		t.Fatalf("Error getting session: %v", err)
+	}
+	session.Options.MaxAge = rememberMeMaxAge
+	session.Values["foo"] = "bar"
+	if err := store.Save(req, rsp, session); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+
+	cookies, ok := rsp.Header()["Set-Cookie"]
+	if !ok || len(cookies) != 1 {
+		t.Fatalf("No cookies. Header: %s", rsp.Header())
+	}
+
+	req2, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	req2.Header.Add("Cookie", cookies[0])
+	session2, err := store.New(req2, "session-key")
+	if err != nil {
+		t.Fatalf("Error getting session: %v", err)
+	}
+	if session2.Options.MaxAge != rememberMeMaxAge {
+		t.Fatalf("expected the per-session MaxAge to survive a sliding-expiration reload, got %d", session2.Options.MaxAge)
+	}
+
+	ttl, err := conn.TTL(context.Background(), "session_sliding_"+session.ID).Result()
+	if err != nil {
+		t.Fatalf("failed to read TTL: %s", err.Error())
+	}
+	if ttl < 29*24*time.Hour {
+		t.Errorf("expected sliding expiration to keep the TTL near 30 days, got %s", ttl)
+	}
+
+	if err := store.Touch(context.Background(), session2); err != nil {
+		t.Fatalf("failed to touch session: %s", err.Error())
+	}
+
+	session2.Options.MaxAge = -1
+	if err := store.Save(req2, NewRecorder(), session2); err != nil {
+		t.Fatalf("failed to clean up session: %s", err.Error())
+	}
+}
+
+// TestEncryptedSessionRoundTrip requires a live Redis (see setup()). It
+// exercises SetEncryption(true) through the public Save/New API the way a
+// real caller would, rather than just the standalone encryptTicket/
+// decryptTicket helpers, and confirms the value actually stored in redis
+// isn't the plaintext serialized session.
+func TestEncryptedSessionRoundTrip(t *testing.T) {
+	conn := newConnection(setup())
+	defer conn.Close()
+	store, err := NewRedisStore(conn, "session_encrypted_", []byte("secret-key"))
+	if err != nil {
+		t.Fatalf("Error getting store: %s", err)
+	}
+	store.SetEncryption(true)
+
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	rsp := NewRecorder()
+	session, err := store.New(req, "session-key")
+	if err != nil {
+		t.Fatalf("Error getting session: %v", err)
+	}
+	session.Values["foo"] = "bar"
+	if err := store.Save(req, rsp, session); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+
+	cookies, ok := rsp.Header()["Set-Cookie"]
+	if !ok || len(cookies) != 1 {
+		t.Fatalf("No cookies. Header: %s", rsp.Header())
+	}
+
+	raw, err := conn.Get(context.Background(), "session_encrypted_"+session.ID).Result()
+	if err != nil {
+		t.Fatalf("failed to read stored value: %s", err.Error())
+	}
+	if strings.Contains(raw, "foo") || strings.Contains(raw, "bar") {
+		t.Fatalf("stored value leaks the plaintext session: %q", raw)
+	}
+
+	req2, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	req2.Header.Add("Cookie", cookies[0])
+	session2, err := store.New(req2, "session-key")
+	if err != nil {
+		t.Fatalf("Error getting session: %v", err)
+	}
+	if session2.IsNew {
+		t.Fatal("expected an existing session, got a new one")
+	}
+	if session2.Values["foo"] != "bar" {
+		t.Errorf("expected session to round-trip, got %+v", session2.Values)
+	}
+
+	session2.Options.MaxAge = -1
+	if err := store.Save(req2, NewRecorder(), session2); err != nil {
+		t.Fatalf("failed to clean up session: %s", err.Error())
+	}
+}
+
+func TestGobSerializer(t *testing.T) {
+	session := sessions.NewSession(nil, "session-key")
+	session.Values = map[interface{}]interface{}{
+		"flash": &FlashMessage{Type: 42, Message: "foo"},
+	}
+
+	var s GobSerializer
+	data, err := s.Serialize(session)
+	if err != nil {
+		t.Fatalf("failed to serialize: %s", err.Error())
+	}
+
+	out := sessions.NewSession(nil, "session-key")
+	out.Values = make(map[interface{}]interface{})
+	if err := s.Deserialize(data, out); err != nil {
+		t.Fatalf("failed to deserialize: %s", err.Error())
+	}
+
+	flash, ok := out.Values["flash"].(*FlashMessage)
+	if !ok {
+		t.Fatalf("expected *FlashMessage, got %T", out.Values["flash"])
+	}
+	if flash.Type != 42 || flash.Message != "foo" {
+		t.Errorf("expected {42 foo}, got %+v", flash)
+	}
+}
+
+func TestTicketEncryption(t *testing.T) {
+	secret, err := generateTicketSecret()
+	if err != nil {
+		t.Fatalf("failed to generate secret: %s", err.Error())
+	}
+
+	plaintext := []byte("super secret session payload")
+	ciphertext, err := encryptTicket(secret, plaintext)
+	if err != nil {
+		t.Fatalf("failed to encrypt: %s", err.Error())
+	}
+	if bytes.Contains(ciphertext, plaintext) {
+		t.Fatalf("ciphertext leaks the plaintext")
+	}
+
+	decrypted, err := decryptTicket(secret, ciphertext)
+	if err != nil {
+		t.Fatalf("failed to decrypt: %s", err.Error())
+	}
+	if !bytes.Equal(decrypted, plaintext) {
+		t.Errorf("expected %q, got %q", plaintext, decrypted)
+	}
+
+	otherSecret, err := generateTicketSecret()
+	if err != nil {
+		t.Fatalf("failed to generate secret: %s", err.Error())
+	}
+	if _, err := decryptTicket(otherSecret, ciphertext); err == nil {
+		t.Error("expected decryption with the wrong secret to fail")
+	}
+
+	cookieValue := encodeTicketCookie("session-id", secret)
+	id, decodedSecret, err := decodeTicketCookie(cookieValue)
+	if err != nil {
+		t.Fatalf("failed to decode ticket cookie: %s", err.Error())
+	}
+	if id != "session-id" || !bytes.Equal(decodedSecret, secret) {
+		t.Errorf("expected (session-id, %x), got (%s, %x)", secret, id, decodedSecret)
+	}
+
+	// A custom KeyGenFunc may generate an ID containing "|", the delimiter
+	// used between the ID and the secret -- it must still round-trip.
+	pipedCookieValue := encodeTicketCookie("tenant-42|session-id", secret)
+	pipedID, pipedSecret, err := decodeTicketCookie(pipedCookieValue)
+	if err != nil {
+		t.Fatalf("failed to decode ticket cookie with a piped id: %s", err.Error())
+	}
+	if pipedID != "tenant-42|session-id" || !bytes.Equal(pipedSecret, secret) {
+		t.Errorf("expected (tenant-42|session-id, %x), got (%s, %x)", secret, pipedID, pipedSecret)
+	}
+}
+
+func TestHashTag(t *testing.T) {
+	a := HashTag("user:123", "session:abc")
+	b := HashTag("user:123", "session:xyz")
+	if clusterSlot(a) != clusterSlot(b) {
+		t.Errorf("expected %q and %q to hash to the same slot", a, b)
+	}
+
+	c := HashTag("user:456", "session:abc")
+	if clusterSlot(a) == clusterSlot(c) {
+		t.Errorf("expected %q and %q to hash to different slots most of the time", a, c)
+	}
+}
+
+// TestCRC16CheckValue pins crc16 against the standard CRC-16/XMODEM check
+// value (poly 0x1021, init 0, no reflection) that Redis Cluster itself uses
+// to compute hash slots.
+func TestCRC16CheckValue(t *testing.T) {
+	if got := crc16("123456789"); got != 0x31C3 {
+		t.Errorf("expected check value 0x31C3, got 0x%X", got)
+	}
+}
+
+// TestClusterSlotHashTag mirrors the example from the Redis Cluster spec:
+// keys sharing a hash tag must land on the same slot.
+func TestClusterSlotHashTag(t *testing.T) {
+	a := clusterSlot("{user1000}.following")
+	b := clusterSlot("{user1000}.followers")
+	if a != b {
+		t.Errorf("expected keys sharing a hash tag to hash to the same slot, got %d and %d", a, b)
+	}
+}
+
+func TestSameSlot(t *testing.T) {
+	if !sameSlot(nil) {
+		t.Error("expected sameSlot(nil) to be true")
+	}
+	if !sameSlot([]string{"only-key"}) {
+		t.Error("expected a single key to be trivially on the same slot")
+	}
+	tagged := []string{HashTag("tenant:1", "a"), HashTag("tenant:1", "b"), HashTag("tenant:1", "c")}
+	if !sameSlot(tagged) {
+		t.Errorf("expected %v to all share a slot via their hash tag", tagged)
+	}
+	untagged := []string{"session_abc", "session_def", "session_ghi"}
+	if sameSlot(untagged) {
+		t.Errorf("expected %v to land on different slots most of the time", untagged)
+	}
+}
+
+// TestMaxAgeEnvelope guards against load silently falling back to the
+// store's default MaxAge for a session that was saved with a longer
+// per-session MaxAge (e.g. a "remember me" cookie), which is exactly what
+// happened before store/load started carrying MaxAge alongside the payload.
+func TestMaxAgeEnvelope(t *testing.T) {
+	const rememberMeMaxAge = 30 * 24 * 3600 // 30 days, much longer than any store default
+	payload := []byte(`{"foo":"bar"}`)
+
+	encoded := encodeMaxAgeEnvelope(rememberMeMaxAge, payload)
+
+	maxAge, decoded, ok := decodeMaxAgeEnvelope(encoded)
+	if !ok {
+		t.Fatalf("expected envelope to be recognized")
+	}
+	if maxAge != rememberMeMaxAge {
+		t.Errorf("expected MaxAge %d, got %d", rememberMeMaxAge, maxAge)
+	}
+	if !bytes.Equal(decoded, payload) {
+		t.Errorf("expected payload %q, got %q", payload, decoded)
+	}
+}
+
+// TestMaxAgeEnvelopeLegacyFallback guards against a value written before the
+// envelope existed (or by an old binary mid rolling-deploy) having its
+// payload corrupted by blindly stripping 4 bytes off the front.
+func TestMaxAgeEnvelopeLegacyFallback(t *testing.T) {
+	legacy := []byte(`{"foo":"bar","counter":1}`)
+
+	maxAge, decoded, ok := decodeMaxAgeEnvelope(legacy)
+	if ok {
+		t.Fatalf("expected a legacy payload not to be recognized as an envelope")
+	}
+	if maxAge != 0 {
+		t.Errorf("expected MaxAge 0 for a legacy payload, got %d", maxAge)
+	}
+	if !bytes.Equal(decoded, legacy) {
+		t.Errorf("expected legacy payload to pass through unchanged, got %q", decoded)
+	}
+}
+
+func TestGroupBySlot(t *testing.T) {
+	keys := []string{
+		HashTag("tenant:1", "a"),
+		HashTag("tenant:1", "b"),
+		HashTag("tenant:2", "a"),
+	}
+	groups := groupBySlot(keys)
+	if len(groups) != 2 {
+		t.Fatalf("expected 2 groups, got %d: %v", len(groups), groups)
+	}
+	total := 0
+	for _, group := range groups {
+		total += len(group)
+	}
+	if total != len(keys) {
+		t.Errorf("expected groupBySlot to account for all %d keys, got %d", len(keys), total)
+	}
+}
@@ -0,0 +1,64 @@
+package redistore
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+
+	"github.com/gorilla/sessions"
+)
+
+// SessionSerializer provides an interface for serialize/deserialize a session.
+type SessionSerializer interface {
+	Deserialize(d []byte, s *sessions.Session) error
+	Serialize(s *sessions.Session) ([]byte, error)
+}
+
+// JSONSerializer encodes the session values to JSON.
+type JSONSerializer struct{}
+
+// Serialize to JSON. Will err if there are unmarshalable key values.
+func (s JSONSerializer) Serialize(ss *sessions.Session) ([]byte, error) {
+	m := make(map[string]interface{}, len(ss.Values))
+	for k, v := range ss.Values {
+		ks, ok := k.(string)
+		if !ok {
+			return nil, fmt.Errorf("redistore: non-string key value, cannot serialize session to JSON: %v", k)
+		}
+		m[ks] = v
+	}
+	return json.Marshal(m)
+}
+
+// Deserialize back to map[string]interface{}.
+func (s JSONSerializer) Deserialize(d []byte, ss *sessions.Session) error {
+	m := make(map[string]interface{})
+	if err := json.Unmarshal(d, &m); err != nil {
+		return err
+	}
+	for k, v := range m {
+		ss.Values[k] = v
+	}
+	return nil
+}
+
+// GobSerializer encodes the session values using encoding/gob, preserving
+// concrete Go types across the round trip. Unlike JSONSerializer it does not
+// flatten custom struct values to map[string]interface{} on the way back
+// out, so callers storing concrete types must gob.Register them.
+type GobSerializer struct{}
+
+// Serialize to Gob.
+func (s GobSerializer) Serialize(ss *sessions.Session) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	if err := gob.NewEncoder(buf).Encode(ss.Values); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Deserialize back to map[interface{}]interface{}.
+func (s GobSerializer) Deserialize(d []byte, ss *sessions.Session) error {
+	return gob.NewDecoder(bytes.NewReader(d)).Decode(&ss.Values)
+}
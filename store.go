@@ -1,6 +1,7 @@
 package redistore
 
 import (
+	"context"
 	"net/http"
 
 	"github.com/gorilla/sessions"
@@ -13,11 +14,20 @@ type Store interface {
 	SetMaxLength(length int) Store
 	Get(r *http.Request, name string) (*sessions.Session, error)
 	New(r *http.Request, name string) (*sessions.Session, error)
+	NewCtx(ctx context.Context, r *http.Request, name string) (*sessions.Session, error)
 	Save(r *http.Request, w http.ResponseWriter, session *sessions.Session) error
+	SaveCtx(ctx context.Context, r *http.Request, w http.ResponseWriter, session *sessions.Session) error
 	Update(session *sessions.Session) error
+	UpdateCtx(ctx context.Context, session *sessions.Session) error
 	Delete(r *http.Request, w http.ResponseWriter, session *sessions.Session) error
+	DeleteCtx(ctx context.Context, r *http.Request, w http.ResponseWriter, session *sessions.Session) error
 	DeleteByID(ids ...string) error
+	DeleteByIDCtx(ctx context.Context, ids ...string) error
 	GetAll() ([]*sessions.Session, error)
+	GetAllCtx(ctx context.Context) ([]*sessions.Session, error)
+	IterateAll(fn func(*sessions.Session) error) error
+	IterateAllCtx(ctx context.Context, fn func(*sessions.Session) error) error
+	Touch(ctx context.Context, session *sessions.Session) error
 	Client() Client
 	Options() *sessions.Options
 	MaxLength() int